@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"strings"
 	"testing"
 )
 
@@ -152,3 +154,204 @@ func TestError(t *testing.T) {
 	fmt.Println("Json Indent:", string(jsonIndent))
 	fmt.Printf("Stack output:%+v\n", err1.Stack())
 }
+
+func TestUnwrap(t *testing.T) {
+	wrapped := ParseError(io.EOF)
+	if !errors.Is(wrapped, io.EOF) {
+		t.Fatalf("errors.Is should walk Unwrap to reach io.EOF, got:%s", wrapped)
+	}
+	if !Equal(wrapped, io.EOF) {
+		t.Fatalf("Equal should walk Unwrap to reach io.EOF, got:%s", wrapped)
+	}
+	if Cause(wrapped) != io.EOF {
+		t.Fatalf("Cause should return io.EOF, got:%v", Cause(wrapped))
+	}
+
+	// an errImpl built purely with New has no cause.
+	e := New("no cause")
+	if Cause(e) != e {
+		t.Fatalf("Cause of an error without a wrapped cause should return itself, got:%v", Cause(e))
+	}
+}
+
+type customErr struct{ msg string }
+
+func (c *customErr) Error() string { return c.msg }
+
+func TestAsTarget(t *testing.T) {
+	orig := &customErr{msg: "boom"}
+	wrapped := As(orig, "reading failed")
+
+	var target *customErr
+	if !AsTarget(wrapped, &target) {
+		t.Fatalf("AsTarget should find the wrapped *customErr")
+	}
+	if target != orig {
+		t.Fatalf("want:%v,but:%v", orig, target)
+	}
+}
+
+func TestStackTrace(t *testing.T) {
+	err1 := New("stack test")
+	stack := err1.Stack()
+	if len(stack) != 1 {
+		t.Fatalf("want 1 stack entry from New,but:%d", len(stack))
+	}
+	entry, ok := stack[0].([]interface{})
+	if !ok || len(entry) == 0 {
+		t.Fatalf("stack entry should be a []interface{},but:%#v", stack[0])
+	}
+	trace, ok := entry[0].(StackTrace)
+	if !ok {
+		t.Fatalf("stack entry[0] should be a StackTrace,but:%#v", entry[0])
+	}
+	if len(trace) == 0 {
+		t.Fatal("New should capture at least one frame")
+	}
+	if trace[0].Function == "" || trace[0].File == "" || trace[0].Line == 0 {
+		t.Fatalf("first frame should be fully populated,but:%#v", trace[0])
+	}
+
+	err2 := err1.As("reason")
+	verbose := fmt.Sprintf("%+v", err2)
+	if !strings.Contains(verbose, "stack test") {
+		t.Fatalf("%%+v should still print the code,got:%s", verbose)
+	}
+	if !strings.Contains(verbose, "reason") {
+		t.Fatalf("%%+v should print the As args,got:%s", verbose)
+	}
+	if strings.Count(verbose, "\n") < 2 {
+		t.Fatalf("%%+v should print one line per frame across both calls,got:%s", verbose)
+	}
+
+	// round-tripping through the Error() text form should turn each
+	// recorded call site back into a StackTrace.
+	reparsed := ParseError(errors.New(err2.Error())).(*errImpl)
+	reStack := reparsed.Stack()
+	last, ok := reStack[len(reStack)-1].([]interface{})
+	if !ok || len(last) == 0 {
+		t.Fatalf("reparsed stack entry should be a []interface{},but:%#v", reStack[len(reStack)-1])
+	}
+	if _, ok := last[0].(StackTrace); !ok {
+		t.Fatalf("reparsed frame should normalize to a StackTrace,but:%#v", last[0])
+	}
+}
+
+func TestRegister(t *testing.T) {
+	sentinel := Register("registered: not found",
+		WithHTTPStatus(404),
+		WithGRPCCode(GRPCNotFound),
+		WithRetryable(false),
+		WithSeverity("warning"),
+	)
+
+	wire := sentinel.As("looking up user 1").Error()
+	reparsed := ParseError(errors.New(wire))
+	if reparsed != sentinel {
+		t.Fatalf("ParseError of a wire error with a registered code should return the sentinel pointer")
+	}
+
+	status, ok := HTTPStatus(reparsed)
+	if !ok || status != 404 {
+		t.Fatalf("want HTTP 404,got:%d,ok:%t", status, ok)
+	}
+	grpcCode, ok := GRPCCode(reparsed)
+	if !ok || grpcCode != GRPCNotFound {
+		t.Fatalf("want GRPCNotFound,got:%v,ok:%t", grpcCode, ok)
+	}
+	if IsRetryable(reparsed) {
+		t.Fatal("sentinel was registered as not retryable")
+	}
+	severity, ok := Severity(reparsed)
+	if !ok || severity != "warning" {
+		t.Fatalf("want severity:warning,got:%s,ok:%t", severity, ok)
+	}
+
+	unregistered := New("not registered")
+	if _, ok := HTTPStatus(unregistered); ok {
+		t.Fatal("unregistered code should not resolve an HTTP status")
+	}
+	if IsRetryable(unregistered) {
+		t.Fatal("unregistered code should not be retryable")
+	}
+	if _, ok := Severity(unregistered); ok {
+		t.Fatal("unregistered code should not resolve a severity")
+	}
+}
+
+func TestErrNoDataIdentity(t *testing.T) {
+	wire := ErrNoData.As("looking up user 1").Error()
+	reparsed := ParseError(errors.New(wire))
+	if reparsed != ErrNoData {
+		t.Fatalf("ParseError of a wire error with ErrNoData's code should return ErrNoData itself")
+	}
+
+	status, ok := HTTPStatus(reparsed)
+	if !ok || status != 404 {
+		t.Fatalf("want HTTP 404,got:%d,ok:%t", status, ok)
+	}
+}
+
+func TestFormatHelper(t *testing.T) {
+	err := As(New("format test"), "reason")
+
+	if got := Format(err, "s"); got != err.Error() {
+		t.Fatalf("Format(err,\"s\") should match Error(),want:%s,got:%s", err.Error(), got)
+	}
+	verbose := Format(err, "+v")
+	if !strings.Contains(verbose, "format test") || !strings.Contains(verbose, "reason") {
+		t.Fatalf("Format(err,\"+v\") should include the code and args,got:%s", verbose)
+	}
+	if Format(nil, "s") != "" {
+		t.Fatal("Format(nil, ...) should return an empty string")
+	}
+}
+
+func BenchmarkNew(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = New("bench code")
+	}
+}
+
+func BenchmarkAs(b *testing.B) {
+	err := New("bench code")
+	b.ResetTimer()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = err.As("reason", i)
+	}
+}
+
+func BenchmarkError(b *testing.B) {
+	err := As(New("bench code"), "reason", 1, 2, 3)
+	b.ResetTimer()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = err.Error()
+	}
+}
+
+// BenchmarkErrorJSONBaseline emulates Error() as it worked before it wrote
+// directly to a pooled buffer: json.Marshal-ing the same wireData() shape
+// MarshalJSON still produces. It exists to give BenchmarkError something to
+// diff against in the same binary, rather than requiring a checkout of the
+// prior implementation to see what changed.
+func BenchmarkErrorJSONBaseline(b *testing.B) {
+	err := As(New("bench code"), "reason", 1, 2, 3).(*errImpl)
+	b.ResetTimer()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf, _ := json.Marshal(err.wireData())
+		_ = string(buf)
+	}
+}
+
+func BenchmarkMarshalJSON(b *testing.B) {
+	err := As(New("bench code"), "reason", 1, 2, 3).(*errImpl)
+	b.ResetTimer()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, _ = err.MarshalJSON()
+	}
+}